@@ -45,6 +45,25 @@ type Config struct {
 	ExtraDelimiters []string
 	MaxClusters     int
 	ParamString     string
+	// Maskers run, in order, before a log line reaches the tokenizer, and
+	// replace variable substrings (timestamps, IPs, IDs, ...) with stable
+	// placeholders so the tokens Drain actually clusters on are more
+	// likely to be true constants. See DefaultMaskers for the built-in
+	// set.
+	//
+	// With the JSON tokenizer, masking instead runs per field value after
+	// the line is parsed, since masking the raw text first can turn a
+	// value into a placeholder that is no longer valid JSON.
+	Maskers []Masker
+	// MaxTrainRatePerSecond, if set, bounds the sustained rate of Train
+	// calls that are actually applied to the tree via a token-bucket
+	// limiter; lines beyond the budget are shed. Leave unset (0) to
+	// disable rate limiting entirely.
+	MaxTrainRatePerSecond float64
+	// BurstSize is the token-bucket's burst capacity. Defaults to
+	// MaxTrainRatePerSecond (i.e. at most one second's worth of burst) if
+	// left at 0.
+	BurstSize int
 }
 
 func createLogClusterCache(maxSize int) *LogClusterCache {
@@ -106,19 +125,6 @@ type Node struct {
 }
 
 func DefaultConfig() *Config {
-	// TODO(kolesnikovae):
-	//
-	// This is crucial for Drain to ensure that the first LogClusterDepth tokens
-	// are constant (see https://jiemingzhu.github.io/pub/pjhe_icws2017.pdf).
-	// We should remove any variables such as timestamps, IDs, IPs, counters, etc.
-	// from these tokens.
-	//
-	// Moreover, Drain is not designed for structured logs. Therefore, we should
-	// handle logfmt (and, probably, JSON) logs in a special way:
-	//
-	// The parse tree should have a fixed length, and the depth should be
-	// determined by the number of fields in the logfmt message.
-	// A parsing tree should be maintained for each unique field set.
 	return &Config{
 		// At training, if at the depth of LogClusterDepth there is a cluster with
 		// similarity coefficient greater that SimTh, then the log message is added
@@ -159,12 +165,17 @@ func New(config *Config, tokenizer string) *Drain {
 	if tokenizer == "logfmt" {
 		myTokenizer = &logfmtTokenizer{tokenizeInsideQuotes: true}
 	}
+	if tokenizer == "json" {
+		myTokenizer = &jsonTokenizer{config: config}
+	}
 
 	d := &Drain{
 		config:      config,
 		rootNode:    createNode(),
 		idToCluster: createLogClusterCache(config.MaxClusters),
 		tokenizer:   myTokenizer,
+		jsonRoots:   make(map[string]*Node),
+		limiter:     newTrainLimiter(config),
 	}
 	return d
 }
@@ -175,6 +186,12 @@ type Drain struct {
 	idToCluster     *LogClusterCache
 	clustersCounter int
 	tokenizer       Tokenizer
+	// jsonRoots holds one prefix-tree root per unique structured field-set
+	// signature, keyed by fieldSetSignature. It's only populated when
+	// tokenizer is a *jsonTokenizer; free-text logs all share rootNode.
+	jsonRoots map[string]*Node
+	// limiter is nil unless Config.MaxTrainRatePerSecond is set.
+	limiter *trainLimiter
 }
 
 func (d *Drain) Clusters() []*LogCluster {
@@ -187,20 +204,42 @@ func (d *Drain) Clusters() []*LogCluster {
 }
 
 func (d *Drain) TrainTokens(tokens []string, stringer func([]string) string, ts int64) *LogCluster {
-	return d.train(tokens, stringer, ts)
+	return d.train(d.rootNodeForTokens(tokens), tokens, stringer, ts)
 }
 
 func (d *Drain) Train(content string, ts int64) *LogCluster {
-	return d.train(d.tokenizer.Marshal(content), d.tokenizer.Unmarshal, ts)
+	content = d.mask(content)
+	if d.limiter != nil && !d.limiter.allow() {
+		return d.sampleDroppedLine(content, ts)
+	}
+	return d.train(d.rootNodeFor(content), d.tokenizer.Marshal(content), d.tokenizer.Unmarshal, ts)
 }
 
-func (d *Drain) train(tokens []string, stringer func([]string) string, ts int64) *LogCluster {
+// sampleDroppedLine is used for lines shed by the optional train-rate
+// limiter: it never creates a cluster or grows the tree, but still touches
+// the Chunks of the existing cluster MatchTokens finds for the line, so
+// sample counts stay approximately correct under a sustained burst. A
+// line with no matching cluster is not recorded.
+func (d *Drain) sampleDroppedLine(content string, ts int64) *LogCluster {
+	cluster := d.MatchTokens(d.getContentAsTokens(content))
+	if cluster == nil {
+		return nil
+	}
+	cluster.append(model.TimeFromUnixNano(ts))
+	return cluster
+}
+
+func (d *Drain) train(root *Node, tokens []string, stringer func([]string) string, ts int64) *LogCluster {
 	for i, token := range tokens {
-		if len(token) > 50 {
+		// Marked tokens (e.g. jsonTokenizer's field-set signature token)
+		// must match byte-for-byte against the same content re-tokenized
+		// outside train(), e.g. by Match/MatchTokens. Truncating one here
+		// would make a cluster impossible to find again.
+		if len(token) > 50 && !isMarkedToken(token) {
 			tokens[i] = token[:50] + d.config.ParamString
 		}
 	}
-	matchCluster := d.treeSearch(d.rootNode, tokens, d.config.SimTh, false)
+	matchCluster := d.treeSearch(root, tokens, d.config.SimTh, false)
 	// Match no existing log cluster
 	if matchCluster == nil {
 		d.clustersCounter++
@@ -214,7 +253,7 @@ func (d *Drain) train(tokens []string, stringer func([]string) string, ts int64)
 		}
 		matchCluster.append(model.TimeFromUnixNano(ts))
 		d.idToCluster.Set(clusterID, matchCluster)
-		d.addSeqToPrefixTree(d.rootNode, matchCluster)
+		d.addSeqToPrefixTree(root, matchCluster)
 	} else {
 		newTemplateTokens := d.createTemplate(tokens, matchCluster.Tokens)
 		matchCluster.Tokens = newTemplateTokens
@@ -280,7 +319,11 @@ func deduplicatePlaceholders(tokens []string, param string) []string {
 }
 
 func (d *Drain) PatternString(c *LogCluster) string {
-	s := strings.Join(deduplicatePlaceholders(c.Tokens, d.config.ParamString), " ")
+	tokens := c.Tokens
+	if _, ok := d.tokenizer.(*jsonTokenizer); ok {
+		tokens = stripFieldSetSigToken(tokens)
+	}
+	s := strings.Join(deduplicatePlaceholders(tokens, d.config.ParamString), " ")
 	if s == d.config.ParamString {
 		return ""
 	}
@@ -293,18 +336,22 @@ func (d *Drain) Delete(cluster *LogCluster) {
 
 // Match against an already existing cluster. Match shall be perfect (sim_th=1.0). New cluster will not be created as a result of this call, nor any cluster modifications.
 func (d *Drain) MatchTokens(contentTokens []string) *LogCluster {
-	matchCluster := d.treeSearch(d.rootNode, contentTokens, 1.0, true)
+	matchCluster := d.treeSearch(d.rootNodeForTokens(contentTokens), contentTokens, 1.0, true)
 	return matchCluster
 }
 
 // Match against an already existing cluster. Match shall be perfect (sim_th=1.0). New cluster will not be created as a result of this call, nor any cluster modifications.
 func (d *Drain) Match(content string) *LogCluster {
+	content = d.mask(content)
 	contentTokens := d.getContentAsTokens(content)
-	matchCluster := d.treeSearch(d.rootNode, contentTokens, 1.0, true)
+	matchCluster := d.treeSearch(d.rootNodeFor(content), contentTokens, 1.0, true)
 	return matchCluster
 }
 
 func (d *Drain) getContentAsTokens(content string) []string {
+	if jt, ok := d.tokenizer.(*jsonTokenizer); ok {
+		return jt.Marshal(content)
+	}
 	for _, extraDelimiter := range d.config.ExtraDelimiters {
 		content = strings.Replace(content, extraDelimiter, " ", -1)
 	}
@@ -393,6 +440,16 @@ func (d *Drain) fastMatch(clusterIDs []int, tokens []string, simTh float64, incl
 	return matchCluster
 }
 
+// isMarkedToken reports whether token is a "marked" token - one that
+// must match exactly rather than being a candidate for Drain's
+// similarity-based wildcarding, signalled by a leading NUL byte. This is
+// how jsonTokenizer's per-line field-set signature token (see
+// fieldSetSigTokenPrefix) asks to be treated as an opaque identifier
+// rather than ordinary log content.
+func isMarkedToken(token string) bool {
+	return len(token) > 0 && token[0] == 0
+}
+
 func (d *Drain) getSeqDistance(clusterTokens, tokens []string, includeParams bool) (float64, int) {
 	if len(clusterTokens) != len(tokens) {
 		panic("seq1 seq2 be of same length")
@@ -404,7 +461,7 @@ func (d *Drain) getSeqDistance(clusterTokens, tokens []string, includeParams boo
 		token1 := clusterTokens[i]
 		token2 := tokens[i]
 		// Require exact match for marked tokens
-		if len(token1) > 0 && token1[0] == 0 && token1 != token2 {
+		if isMarkedToken(token1) && token1 != token2 {
 			return 0, -1
 		}
 		if token1 == d.config.ParamString {
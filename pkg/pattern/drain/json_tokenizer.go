@@ -0,0 +1,213 @@
+package drain
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// jsonTokenizer tokenizes a log line by parsing it as a JSON object,
+// flattening nested objects into dotted keys, and emitting one
+// "key=value" token per field in sorted key order, preceded by a
+// synthetic fieldSetSigTokenPrefix token identifying the field set.
+// Sorting the keys makes the token stream stable regardless of the order
+// fields happen to appear in the source JSON, which is what lets two
+// structurally identical lines land in the same cluster. The leading
+// signature token is what lets rootNodeForTokens recover the field-set
+// subtree from tokens alone - see its doc comment for why that can't be
+// done by re-deriving the signature from the "key=value" tokens once
+// Drain has wildcarded one of them.
+//
+// Lines that fail to parse as a JSON object fall back to
+// adaptiveLogsTokenizer, so a stream that mixes structured and
+// unstructured lines is still handled; no signature token is emitted for
+// those.
+//
+// config.Maskers, if set, are applied per field value rather than to the
+// raw line: masking the raw JSON text first can turn a bare numeric,
+// boolean or other unquoted value into a placeholder like <NUM> that is
+// no longer valid JSON (e.g. {"code":200} -> {"code":<NUM>}), which would
+// break parsing entirely. Drain.mask is a no-op for this tokenizer for
+// the same reason; see jsonTokenizer.mask below.
+type jsonTokenizer struct {
+	fallback adaptiveLogsTokenizer
+	config   *Config
+}
+
+func (t *jsonTokenizer) Marshal(line string) []string {
+	fields, ok := flattenJSONLine(line)
+	if !ok {
+		return t.fallback.Marshal(t.mask(line))
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tokens := make([]string, 0, len(keys)+1)
+	tokens = append(tokens, fieldSetSigToken(encodeFieldSetKeys(keys)))
+	for _, k := range keys {
+		tokens = append(tokens, k+"="+t.mask(fields[k]))
+	}
+	return tokens
+}
+
+func (t *jsonTokenizer) Unmarshal(tokens []string) string {
+	return strings.Join(stripFieldSetSigToken(tokens), " ")
+}
+
+// mask runs value through t.config.Maskers, in order. It's a no-op when
+// no Maskers are configured.
+func (t *jsonTokenizer) mask(value string) string {
+	for _, m := range t.config.Maskers {
+		value = m.Mask(value)
+	}
+	return value
+}
+
+// flattenJSONLine parses line as a JSON object and flattens it into a
+// flat map of dotted key -> stringified value. ok is false if line isn't
+// *purely* a JSON object - e.g. plain text, a JSON array/scalar, or a
+// valid JSON object followed by trailing non-JSON bytes, since that's
+// not a structured log line so much as free text that happens to start
+// with one.
+//
+// Numbers are decoded as json.Number rather than float64, so large
+// integers (trace IDs, nanosecond timestamps) stringify back to their
+// exact source digits instead of losing precision past 2^53.
+func flattenJSONLine(line string) (map[string]string, bool) {
+	var raw map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	// A bare null decodes into a nil map without error.
+	if err := dec.Decode(&raw); err != nil || raw == nil {
+		return nil, false
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, false
+	}
+
+	fields := make(map[string]string, len(raw))
+	flattenJSONInto(fields, "", raw)
+	return fields, true
+}
+
+func flattenJSONInto(dst map[string]string, prefix string, value interface{}) {
+	if nested, ok := value.(map[string]interface{}); ok {
+		for k, v := range nested {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flattenJSONInto(dst, key, v)
+		}
+		return
+	}
+	dst[prefix] = fmt.Sprintf("%v", value)
+}
+
+// fieldSetSignature returns a stable identifier for a structured log
+// line's field set, derived from its sorted, dotted keys. Two lines with
+// the same signature are guaranteed to carry the same fields.
+func fieldSetSignature(fields map[string]string) string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return encodeFieldSetKeys(keys)
+}
+
+// encodeFieldSetKeys turns a sequence of keys into an unambiguous
+// signature: each key is length-prefixed so that, say, the single key
+// "a,b" can never collide with the two keys "a" and "b" - a bare
+// strings.Join(keys, ",") would conflate them since keys may themselves
+// contain commas.
+func encodeFieldSetKeys(keys []string) string {
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%d:%s,", len(k), k)
+	}
+	return b.String()
+}
+
+// fieldSetSigTokenPrefix marks the synthetic token jsonTokenizer.Marshal
+// prepends to every structured line's token stream to carry its
+// field-set signature. A real "key=value" token never takes its place:
+// Marshal always emits the signature token first, and only the first
+// token is ever checked for this prefix. (A JSON key can still carry a
+// NUL byte through the \u0000 escape.) The leading NUL also makes Drain's existing "marked token" rule
+// in getSeqDistance require an exact match on it, so a candidate line can
+// never fastMatch into a cluster from a different field set even within
+// the same subtree.
+const fieldSetSigTokenPrefix = "\x00jsonfieldset:"
+
+// fieldSetSigToken wraps a field-set signature as the synthetic leading
+// token jsonTokenizer.Marshal emits for every structured line.
+func fieldSetSigToken(sig string) string {
+	return fieldSetSigTokenPrefix + sig
+}
+
+// stripFieldSetSigToken drops the leading signature token, if tokens
+// begins with one, returning the remaining "key=value" tokens.
+func stripFieldSetSigToken(tokens []string) []string {
+	if len(tokens) > 0 && strings.HasPrefix(tokens[0], fieldSetSigTokenPrefix) {
+		return tokens[1:]
+	}
+	return tokens
+}
+
+// rootNodeFor returns the prefix-tree root content should be trained into
+// or matched against. Structured lines get their own root per unique
+// field-set signature - created lazily - so that, say, {"a":1,"b":2} and
+// {"c":3,"d":4} never collide in the same subtree just because they
+// happen to have the same number of fields. Everything else, including
+// structured lines the JSON tokenizer fails to parse, shares rootNode.
+func (d *Drain) rootNodeFor(content string) *Node {
+	if _, ok := d.tokenizer.(*jsonTokenizer); !ok {
+		return d.rootNode
+	}
+	fields, ok := flattenJSONLine(content)
+	if !ok {
+		return d.rootNode
+	}
+
+	sig := fieldSetSignature(fields)
+	return d.jsonRootForSignature(sig)
+}
+
+// rootNodeForTokens resolves the same per-field-set subtree rootNodeFor
+// would, but from already-tokenized input where the original content
+// string isn't available (e.g. MatchTokens, or a cluster's Tokens during
+// Merge). It reads the signature straight off the leading
+// fieldSetSigToken jsonTokenizer.Marshal embeds in every structured
+// line's tokens, rather than re-deriving it from the "key=value" tokens
+// themselves: once Drain has generalized a cluster's template, a field
+// value token can be replaced wholesale by config.ParamString (losing the
+// key), which would otherwise make the signature unrecoverable or wrong
+// for any cluster that's been through so much as one merge or template
+// update. The leading signature token itself is never wildcarded, since
+// it's identical for every line landing in the same per-field-set
+// subtree.
+func (d *Drain) rootNodeForTokens(tokens []string) *Node {
+	if _, ok := d.tokenizer.(*jsonTokenizer); !ok {
+		return d.rootNode
+	}
+	if len(tokens) == 0 || !strings.HasPrefix(tokens[0], fieldSetSigTokenPrefix) {
+		return d.rootNode
+	}
+	sig := strings.TrimPrefix(tokens[0], fieldSetSigTokenPrefix)
+	return d.jsonRootForSignature(sig)
+}
+
+func (d *Drain) jsonRootForSignature(sig string) *Node {
+	root, ok := d.jsonRoots[sig]
+	if !ok {
+		root = createNode()
+		d.jsonRoots[sig] = root
+	}
+	return root
+}
@@ -0,0 +1,155 @@
+package drain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONTokenizerFlattensNestedObjects(t *testing.T) {
+	fields, ok := flattenJSONLine(`{"level":"info","http":{"method":"GET","status":200}}`)
+	require.True(t, ok)
+	require.Equal(t, map[string]string{
+		"level":       "info",
+		"http.method": "GET",
+		"http.status": "200",
+	}, fields)
+}
+
+func TestJSONTokenizerPreservesLargeIntegerPrecision(t *testing.T) {
+	fields, ok := flattenJSONLine(`{"trace_id":123456789012345678}`)
+	require.True(t, ok)
+	require.Equal(t, "123456789012345678", fields["trace_id"])
+}
+
+func TestJSONTokenizerNonJSONFallsBack(t *testing.T) {
+	_, ok := flattenJSONLine("this is not json")
+	require.False(t, ok)
+}
+
+func TestJSONTokenizerRejectsTrailingNonJSONBytes(t *testing.T) {
+	_, ok := flattenJSONLine(`{"level":"info"} extra suffix text`)
+	require.False(t, ok)
+}
+
+
+func TestDrainJSONTokenizerPerFieldSetSubtrees(t *testing.T) {
+	d := New(DefaultConfig(), "json")
+
+	d.Train(`{"level":"info","msg":"started"}`, 0)
+	d.Train(`{"region":"us","code":200}`, 1)
+
+	require.NotNil(t, d.Match(`{"level":"info","msg":"started"}`))
+	require.NotNil(t, d.Match(`{"region":"us","code":200}`))
+
+	require.Len(t, d.jsonRoots, 2)
+}
+
+func TestMatchTokensResolvesJSONFieldSetSubtree(t *testing.T) {
+	d := New(DefaultConfig(), "json")
+
+	trained := d.Train(`{"level":"info","msg":"started"}`, 0)
+	require.NotNil(t, trained)
+
+	matched := d.MatchTokens(d.tokenizer.Marshal(`{"level":"info","msg":"started"}`))
+	require.NotNil(t, matched)
+	require.Equal(t, trained.id, matched.id)
+}
+
+func TestFieldSetSignatureDoesNotCollideOnKeysContainingCommas(t *testing.T) {
+	oneField := fieldSetSignature(map[string]string{"a,b": "1"})
+	twoFields := fieldSetSignature(map[string]string{"a": "1", "b": "2"})
+	require.NotEqual(t, oneField, twoFields)
+}
+
+func TestJSONTokenizerMasksFieldValuesNotRawLine(t *testing.T) {
+	d := New(DefaultConfig(), "json")
+	d.config.Maskers = DefaultMaskers()
+
+	trained := d.Train(`{"level":"info","code":200}`, 0)
+	require.NotNil(t, trained)
+
+	// If masking ran on the raw line before JSON parsing, counterRegex
+	// would turn 200 into the unquoted placeholder <NUM>, making the line
+	// invalid JSON; it would then land in the shared fallback root rather
+	// than its own per-field-set subtree.
+	require.Len(t, d.jsonRoots, 1)
+	require.Empty(t, d.rootNode.keyToChildNode)
+
+	matched := d.Match(`{"level":"info","code":404}`)
+	require.NotNil(t, matched)
+	require.Equal(t, trained.id, matched.id)
+}
+
+func TestDrainJSONTokenizerSingleFieldSchemaRequiresSimilarity(t *testing.T) {
+	d := New(DefaultConfig(), "json")
+
+	first := d.Train(`{"a":"hello"}`, 0)
+	require.NotNil(t, first)
+
+	// A wildly different value for the same lone field must not be
+	// unconditionally folded into the first cluster: with only one field
+	// token (plus the signature token), this used to hit treeSearch's
+	// tokenCount<2 fast path, which returns the sole existing cluster
+	// without any similarity check at all.
+	second := d.Train(`{"a":"completely-different-value-entirely"}`, 1)
+	require.NotNil(t, second)
+
+	require.NotNil(t, d.Match(`{"a":"hello"}`))
+}
+
+func TestRootNodeForTokensSurvivesWildcardedFieldValue(t *testing.T) {
+	d := New(DefaultConfig(), "json")
+
+	d.Train(`{"a":"x"}`, 0)
+	trained := d.Train(`{"a":"y"}`, 1)
+	require.NotNil(t, trained)
+	// The lone field's value token has now been generalized to
+	// config.ParamString, which no longer contains "=". Re-deriving the
+	// field-set signature from the "key=value" tokens would no longer be
+	// possible at this point.
+	require.Contains(t, trained.Tokens, d.config.ParamString)
+
+	matched := d.MatchTokens(trained.Tokens)
+	require.NotNil(t, matched)
+	require.Equal(t, trained.id, matched.id)
+	require.Empty(t, d.rootNode.keyToChildNode, "the cluster must live in its json subtree, not the shared root")
+}
+
+func TestPatternStringOmitsFieldSetSigToken(t *testing.T) {
+	d := New(DefaultConfig(), "json")
+
+	trained := d.Train(`{"level":"info"}`, 0)
+	require.NotNil(t, trained)
+
+	require.Equal(t, "level=info", d.PatternString(trained))
+}
+
+func TestDrainJSONTokenizerMatchesAfterTrainWithManyFields(t *testing.T) {
+	d := New(DefaultConfig(), "json")
+
+	// Five field names push the encoded field-set signature token past
+	// train()'s 50-byte truncation threshold for ordinary tokens. If the
+	// signature token were truncated on train but not on match, the two
+	// would no longer compare equal and the freshly trained line would
+	// fail to match itself.
+	line := `{"level":"info","message":"started","request_id":"r1","service_name":"api","trace_id_value":"t1"}`
+
+	trained := d.Train(line, 0)
+	require.NotNil(t, trained)
+
+	matched := d.Match(line)
+	require.NotNil(t, matched)
+	require.Equal(t, trained.id, matched.id)
+}
+
+func TestDrainJSONTokenizerMixedStream(t *testing.T) {
+	d := New(DefaultConfig(), "json")
+
+	d.Train(`{"level":"info","msg":"started"}`, 0)
+	d.Train("plain text log line here", 1)
+	d.Train("plain text log line here", 2)
+
+	require.NotNil(t, d.Match(`{"level":"info","msg":"started"}`))
+	require.NotNil(t, d.Match("plain text log line here"))
+}
@@ -0,0 +1,93 @@
+package drain
+
+import "regexp"
+
+// Masker replaces dynamic substrings of a log line - timestamps, IPs,
+// IDs and the like - with a stable placeholder before the line is
+// tokenized. Masking ahead of tokenization makes it far more likely that
+// the first LogClusterDepth tokens of a message are true constants, which
+// is the assumption Drain's clustering is built on.
+//
+// Masked placeholders (e.g. "<IP>") are distinct from the wildcard
+// ParamString Drain substitutes for tokens that vary across the members
+// of a cluster: a masked placeholder is treated as a constant for tree
+// traversal, while ParamString marks a position Drain itself has decided
+// is variable.
+type Masker interface {
+	Mask(line string) string
+}
+
+// MaskerFunc adapts a plain function to the Masker interface.
+type MaskerFunc func(line string) string
+
+func (f MaskerFunc) Mask(line string) string { return f(line) }
+
+type regexMasker struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+func (m *regexMasker) Mask(line string) string {
+	return m.re.ReplaceAllString(line, m.replacement)
+}
+
+// NewRegexMasker returns a Masker that replaces every match of re with
+// replacement.
+func NewRegexMasker(re *regexp.Regexp, replacement string) Masker {
+	return &regexMasker{re: re, replacement: replacement}
+}
+
+var (
+	rfc3339Regex    = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[Tt ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`)
+	syslogTimeRegex = regexp.MustCompile(`\b[A-Z][a-z]{2}\s+\d{1,2}\s\d{2}:\d{2}:\d{2}\b`)
+	apacheTimeRegex = regexp.MustCompile(`\[\d{2}/[A-Za-z]{3}/\d{4}:\d{2}:\d{2}:\d{2}\s[+-]\d{4}\]`)
+
+	ipv4Regex = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	ipv6Regex = regexp.MustCompile(`\b[0-9A-Fa-f]{1,4}(?::[0-9A-Fa-f]{0,4}){2,7}\b`)
+
+	uuidRegex  = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+	hexIDRegex = regexp.MustCompile(`\b0x[0-9a-fA-F]+\b|\b[0-9a-fA-F]{16,}\b`)
+
+	emailRegex   = regexp.MustCompile(`\b[\w.+-]+@[\w-]+\.[\w.-]+\b`)
+	urlRegex     = regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://\S+`)
+	counterRegex = regexp.MustCompile(`\b\d+\b`)
+)
+
+// DefaultMaskers returns the built-in set of regex-based maskers for
+// timestamps (RFC3339, syslog and Apache common log format), IPv4/IPv6
+// addresses, UUIDs, hex IDs, email addresses, URLs and numeric counters.
+// It is not enabled by default - set Config.Maskers = DefaultMaskers() to
+// opt in.
+//
+// Order matters: more specific patterns run before the generic numeric
+// counter mask so they aren't shadowed by it.
+func DefaultMaskers() []Masker {
+	return []Masker{
+		NewRegexMasker(rfc3339Regex, "<TIMESTAMP>"),
+		NewRegexMasker(syslogTimeRegex, "<TIMESTAMP>"),
+		NewRegexMasker(apacheTimeRegex, "<TIMESTAMP>"),
+		NewRegexMasker(uuidRegex, "<UUID>"),
+		NewRegexMasker(ipv6Regex, "<IP>"),
+		NewRegexMasker(ipv4Regex, "<IP>"),
+		NewRegexMasker(emailRegex, "<EMAIL>"),
+		NewRegexMasker(urlRegex, "<URL>"),
+		NewRegexMasker(hexIDRegex, "<HEXID>"),
+		NewRegexMasker(counterRegex, "<NUM>"),
+	}
+}
+
+// mask runs content through d.config.Maskers, in order, before it reaches
+// the tokenizer. It's a no-op when no Maskers are configured, and also a
+// no-op when the tokenizer is the JSON tokenizer: masking the raw JSON
+// text can turn a bare value into an unquoted placeholder that is no
+// longer valid JSON, so jsonTokenizer instead masks each flattened field
+// value itself, after parsing. See jsonTokenizer.mask.
+func (d *Drain) mask(content string) string {
+	if _, ok := d.tokenizer.(*jsonTokenizer); ok {
+		return content
+	}
+	for _, m := range d.config.Maskers {
+		content = m.Mask(content)
+	}
+	return content
+}
@@ -0,0 +1,38 @@
+package drain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultMaskers(t *testing.T) {
+	d := New(DefaultConfig(), "")
+	d.config.Maskers = DefaultMaskers()
+
+	cases := []struct {
+		line string
+		want string
+	}{
+		{"ts=2026-07-27T10:00:00Z level=info msg=ready", "ts=<TIMESTAMP> level=info msg=ready"},
+		{"client connected from 10.0.0.1", "client connected from <IP>"},
+		{"request id=550e8400-e29b-41d4-a716-446655440000", "request id=<UUID>"},
+		{"contact admin@example.com for help", "contact <EMAIL> for help"},
+		{"processed 42 items", "processed <NUM> items"},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.want, d.mask(c.line), "line: %s", c.line)
+	}
+}
+
+func TestMaskersGroupVariantsIntoOneCluster(t *testing.T) {
+	d := New(DefaultConfig(), "")
+	d.config.Maskers = DefaultMaskers()
+
+	d.Train("ts=2026-07-27T10:00:00Z client=10.0.0.1 msg=connected", 0)
+	d.Train("ts=2026-07-27T10:00:05Z client=10.0.0.2 msg=connected", 1)
+
+	matched := d.Match("ts=2026-07-27T10:00:10Z client=10.0.0.3 msg=connected")
+	require.NotNil(t, matched)
+	require.Equal(t, 2, matched.Size)
+}
@@ -0,0 +1,89 @@
+package drain
+
+import "fmt"
+
+// Merge unions the templates learned by other into d. Each of other's
+// clusters has its tokens copied and re-learned through the same treeSearch /
+// addSeqToPrefixTree codepath Train uses, so merged clusters are subject
+// to the receiver's MaxClusters LRU bound exactly as if they'd been
+// trained locally. This is the building block for periodically
+// consolidating the per-ingester models of a sharded pattern service,
+// where each ingester learns clusters from the stream it owns.
+//
+// Merge refuses to combine Drain instances configured differently, since
+// their trees aren't comparable: a different LogClusterDepth, MaxChildren
+// or SimTh changes where clusters land and how similarity is judged, and
+// a different ParamString means "wildcard" tokens wouldn't even compare
+// equal.
+func (d *Drain) Merge(other *Drain) error {
+	if err := checkMergeable(d.config, other.config); err != nil {
+		return err
+	}
+	for _, cluster := range other.idToCluster.Values() {
+		d.mergeCluster(cluster)
+	}
+	return nil
+}
+
+func checkMergeable(a, b *Config) error {
+	switch {
+	case a.LogClusterDepth != b.LogClusterDepth:
+		return fmt.Errorf("cannot merge Drain models with different LogClusterDepth (%d != %d)", a.LogClusterDepth, b.LogClusterDepth)
+	case a.MaxChildren != b.MaxChildren:
+		return fmt.Errorf("cannot merge Drain models with different MaxChildren (%d != %d)", a.MaxChildren, b.MaxChildren)
+	case a.SimTh != b.SimTh:
+		return fmt.Errorf("cannot merge Drain models with different SimTh (%v != %v)", a.SimTh, b.SimTh)
+	case a.ParamString != b.ParamString:
+		return fmt.Errorf("cannot merge Drain models with different ParamString (%q != %q)", a.ParamString, b.ParamString)
+	}
+	return nil
+}
+
+// MergeInto merges src's clusters into dst, applying the same
+// compatibility checks and LRU-respecting semantics as (*Drain).Merge. It
+// exists so callers that already hold both Drain instances can merge
+// without it mattering which one happens to be the receiver, e.g. when
+// consolidating many per-ingester models into a fresh aggregate.
+func MergeInto(dst, src *Drain) error {
+	return dst.Merge(src)
+}
+
+// mergeCluster folds a cluster learned by another Drain instance into d.
+// If a matching cluster already exists it combines the two templates via
+// createTemplate and adds the incoming Chunks/Size onto it; otherwise the
+// cluster is added to the tree as if freshly trained.
+func (d *Drain) mergeCluster(cluster *LogCluster) {
+	tokens := make([]string, len(cluster.Tokens))
+	copy(tokens, cluster.Tokens)
+
+	root := d.rootNodeForTokens(tokens)
+	matchCluster := d.treeSearch(root, tokens, d.config.SimTh, false)
+	if matchCluster == nil {
+		d.clustersCounter++
+		// Copy rather than alias cluster.Chunks, down to each chunk's
+		// Samples: cluster still belongs to other, which may keep
+		// appending to it, or bumping its last sample, after this merge
+		// returns.
+		chunks := make(Chunks, len(cluster.Chunks))
+		for i, c := range cluster.Chunks {
+			chunks[i] = c
+			chunks[i].Samples = append(c.Samples[:0:0], c.Samples...)
+		}
+		newCluster := &LogCluster{
+			Tokens:   tokens,
+			id:       d.clustersCounter,
+			Size:     cluster.Size,
+			Stringer: cluster.Stringer,
+			Chunks:   chunks,
+		}
+		d.idToCluster.Set(newCluster.id, newCluster)
+		d.addSeqToPrefixTree(root, newCluster)
+		return
+	}
+
+	matchCluster.Tokens = d.createTemplate(tokens, matchCluster.Tokens)
+	matchCluster.Size += cluster.Size
+	matchCluster.Chunks = append(matchCluster.Chunks, cluster.Chunks...)
+	// Touch cluster to update its state in the cache.
+	d.idToCluster.Get(matchCluster.id)
+}
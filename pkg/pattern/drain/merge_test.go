@@ -0,0 +1,73 @@
+package drain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeCombinesTemplatesAndSizes(t *testing.T) {
+	a := New(DefaultConfig(), "")
+	b := New(DefaultConfig(), "")
+
+	a.Train("caller=foo.go user=alice msg=\"hello world\"", 0)
+	a.Train("caller=foo.go user=bob msg=\"hello world\"", 1)
+
+	b.Train("caller=foo.go user=carol msg=\"hello world\"", 2)
+	b.Train("level=error err=\"timeout\"", 3)
+
+	require.NoError(t, a.Merge(b))
+
+	matched := a.Match("caller=foo.go user=dave msg=\"hello world\"")
+	require.NotNil(t, matched)
+	require.Equal(t, 3, matched.Size)
+
+	require.NotNil(t, a.Match("level=error err=\"timeout\""))
+}
+
+func TestMergeDoesNotAliasSourceChunks(t *testing.T) {
+	a := New(DefaultConfig(), "")
+	b := New(DefaultConfig(), "")
+
+	b.Train("caller=foo.go msg=unique-to-b", 0)
+
+	require.NoError(t, a.Merge(b))
+
+	merged := a.Match("caller=foo.go msg=unique-to-b")
+	require.NotNil(t, merged)
+	chunksAfterMerge := make(Chunks, len(merged.Chunks))
+	for i, c := range merged.Chunks {
+		chunksAfterMerge[i] = c
+		chunksAfterMerge[i].Samples = append(c.Samples[:0:0], c.Samples...)
+	}
+
+	// b keeps training after the merge; a's copy must be unaffected.
+	b.Train("caller=foo.go msg=unique-to-b", 1)
+	b.Train("caller=foo.go msg=unique-to-b", 2)
+
+	require.Equal(t, chunksAfterMerge, merged.Chunks)
+}
+
+func TestMergeKeepsJSONSchemasInSeparateSubtrees(t *testing.T) {
+	a := New(DefaultConfig(), "json")
+	b := New(DefaultConfig(), "json")
+
+	a.Train(`{"level":"info","msg":"started"}`, 0)
+	b.Train(`{"region":"us","code":200}`, 1)
+
+	require.NoError(t, a.Merge(b))
+
+	require.NotNil(t, a.Match(`{"level":"info","msg":"started"}`))
+	require.NotNil(t, a.Match(`{"region":"us","code":200}`))
+	require.Len(t, a.jsonRoots, 2)
+}
+
+func TestMergeRejectsIncompatibleConfigs(t *testing.T) {
+	a := New(DefaultConfig(), "")
+
+	otherCfg := DefaultConfig()
+	otherCfg.SimTh = 0.9
+	b := New(otherCfg, "")
+
+	require.Error(t, a.Merge(b))
+}
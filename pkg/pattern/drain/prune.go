@@ -0,0 +1,116 @@
+package drain
+
+import (
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// PruneOptions configures (*Drain).Prune.
+type PruneOptions struct {
+	// MaxAge removes a cluster once its most recent sample is older than
+	// this, regardless of Size.
+	MaxAge time.Duration
+	// MinAge is how long a cluster must have existed before MinSize is
+	// enforced against it, so short-lived bursts aren't pruned before
+	// they've had a chance to grow.
+	MinAge time.Duration
+	// MinSize removes clusters with fewer than MinSize samples once
+	// they're older than MinAge.
+	MinSize int
+}
+
+// PruneStats reports the outcome of a Prune call.
+type PruneStats struct {
+	ClustersRemoved int
+	NodesFreed      int
+}
+
+// Prune removes clusters that have aged out (PruneOptions.MaxAge) or
+// never grew past PruneOptions.MinSize within PruneOptions.MinAge, and
+// garbage-collects any prefix-tree nodes left with no reachable clusters
+// as a result - across rootNode and every per-field-set root in
+// jsonRoots. Today the LRU inside LogClusterCache only bounds the number
+// of clusters, and addSeqToPrefixTree only lazily filters stale cluster
+// IDs out of the leaf node it's currently writing to - neither reclaims
+// dead branches elsewhere in the tree. Prune is meant to be called
+// periodically from a maintenance loop so that a long-lived Drain doesn't
+// accumulate those dead branches forever.
+func (d *Drain) Prune(opts PruneOptions) PruneStats {
+	now := model.Now()
+	var stats PruneStats
+
+	for _, cluster := range d.idToCluster.Values() {
+		if shouldPrune(cluster, opts, now) {
+			d.idToCluster.cache.Remove(cluster.id)
+			stats.ClustersRemoved++
+		}
+	}
+
+	stats.NodesFreed = d.pruneNode(d.rootNode)
+	for sig, root := range d.jsonRoots {
+		stats.NodesFreed += d.pruneNode(root)
+		if len(root.clusterIDs) == 0 && len(root.keyToChildNode) == 0 {
+			delete(d.jsonRoots, sig)
+			stats.NodesFreed++
+		}
+	}
+	return stats
+}
+
+func shouldPrune(cluster *LogCluster, opts PruneOptions, now model.Time) bool {
+	first, last, ok := clusterTimeRange(cluster)
+	if !ok {
+		return false
+	}
+	if opts.MaxAge > 0 && now.Sub(last) > opts.MaxAge {
+		return true
+	}
+	if opts.MinSize > 0 && now.Sub(first) > opts.MinAge && cluster.Size < opts.MinSize {
+		return true
+	}
+	return false
+}
+
+// clusterTimeRange returns the earliest and latest sample timestamps
+// recorded across a cluster's Chunks. ok is false if the cluster has no
+// samples at all.
+func clusterTimeRange(cluster *LogCluster) (first, last model.Time, ok bool) {
+	for _, chunk := range cluster.Chunks {
+		for _, sample := range chunk.Samples {
+			if !ok || sample.Timestamp < first {
+				first = sample.Timestamp
+			}
+			if !ok || sample.Timestamp > last {
+				last = sample.Timestamp
+			}
+			ok = true
+		}
+	}
+	return first, last, ok
+}
+
+// pruneNode recursively drops clusterIDs that no longer resolve in
+// idToCluster, then removes any child node left with neither clusterIDs
+// nor children of its own. It returns the number of nodes freed.
+func (d *Drain) pruneNode(node *Node) int {
+	freed := 0
+
+	liveClusterIDs := make([]int, 0, len(node.clusterIDs))
+	for _, id := range node.clusterIDs {
+		if d.idToCluster.Get(id) != nil {
+			liveClusterIDs = append(liveClusterIDs, id)
+		}
+	}
+	node.clusterIDs = liveClusterIDs
+
+	for key, child := range node.keyToChildNode {
+		freed += d.pruneNode(child)
+		if len(child.clusterIDs) == 0 && len(child.keyToChildNode) == 0 {
+			delete(node.keyToChildNode, key)
+			freed++
+		}
+	}
+
+	return freed
+}
@@ -0,0 +1,62 @@
+package drain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneRemovesAgedOutClusters(t *testing.T) {
+	d := New(DefaultConfig(), "")
+
+	old := time.Now().Add(-time.Hour)
+	d.Train("caller=foo.go msg=stale", old.UnixNano())
+	d.Train("caller=bar.go msg=fresh", time.Now().UnixNano())
+
+	stats := d.Prune(PruneOptions{MaxAge: time.Minute})
+	require.Equal(t, 1, stats.ClustersRemoved)
+
+	require.Nil(t, d.Match("caller=foo.go msg=stale"))
+	require.NotNil(t, d.Match("caller=bar.go msg=fresh"))
+}
+
+func TestPruneRemovesUndersizedOldClusters(t *testing.T) {
+	d := New(DefaultConfig(), "")
+
+	old := time.Now().Add(-time.Hour)
+	d.Train("caller=foo.go msg=rare", old.UnixNano())
+
+	stats := d.Prune(PruneOptions{MinAge: time.Minute, MinSize: 2})
+	require.Equal(t, 1, stats.ClustersRemoved)
+	require.Nil(t, d.Match("caller=foo.go msg=rare"))
+}
+
+func TestPruneKeepsYoungUndersizedClusters(t *testing.T) {
+	d := New(DefaultConfig(), "")
+	d.Train("caller=foo.go msg=rare", time.Now().UnixNano())
+
+	stats := d.Prune(PruneOptions{MinAge: time.Hour, MinSize: 2})
+	require.Equal(t, 0, stats.ClustersRemoved)
+	require.NotNil(t, d.Match("caller=foo.go msg=rare"))
+}
+
+func TestPruneWalksJSONRoots(t *testing.T) {
+	d := New(DefaultConfig(), "json")
+
+	old := time.Now().Add(-time.Hour)
+	d.Train(`{"level":"info","msg":"stale"}`, old.UnixNano())
+	d.Train(`{"region":"us","code":200}`, time.Now().UnixNano())
+
+	stats := d.Prune(PruneOptions{MaxAge: time.Minute})
+	require.Equal(t, 1, stats.ClustersRemoved)
+	require.Greater(t, stats.NodesFreed, 0)
+
+	// The emptied field-set root for {"level","msg"} should itself have
+	// been reclaimed from jsonRoots. This is checked before the Match calls
+	// below, since Match creates a field-set root lazily when it is missing.
+	require.Len(t, d.jsonRoots, 1)
+
+	require.Nil(t, d.Match(`{"level":"info","msg":"stale"}`))
+	require.NotNil(t, d.Match(`{"region":"us","code":200}`))
+}
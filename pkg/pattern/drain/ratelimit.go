@@ -0,0 +1,122 @@
+package drain
+
+import (
+	"sync"
+	"time"
+)
+
+// ewmaDecay is the weight given to each newly observed per-second rate
+// when folding it into trainLimiter.ewmaRate.
+const ewmaDecay = 0.2
+
+// trainLimiter is a token-bucket rate limiter guarding (*Drain).Train,
+// paired with an EWMA monitor of the observed ingestion rate. Under a
+// bursty log storm, Train would otherwise walk and mutate the prefix tree
+// without bound; trainLimiter lets operators cap that work per tenant by
+// shedding lines once the budget for the current second is spent, rather
+// than blocking the caller until budget frees up.
+type trainLimiter struct {
+	mu sync.Mutex
+
+	rate  float64
+	burst float64
+
+	tokens     float64
+	lastRefill time.Time
+
+	windowStart time.Time
+	windowCount uint64
+	ewmaRate    float64
+
+	trained uint64
+	dropped uint64
+}
+
+// newTrainLimiter returns nil if cfg.MaxTrainRatePerSecond is unset, which
+// callers treat as "rate limiting disabled".
+func newTrainLimiter(cfg *Config) *trainLimiter {
+	if cfg.MaxTrainRatePerSecond <= 0 {
+		return nil
+	}
+	burst := float64(cfg.BurstSize)
+	if burst <= 0 {
+		burst = cfg.MaxTrainRatePerSecond
+	}
+	now := time.Now()
+	return &trainLimiter{
+		rate:        cfg.MaxTrainRatePerSecond,
+		burst:       burst,
+		tokens:      burst,
+		lastRefill:  now,
+		windowStart: now,
+	}
+}
+
+// allow reports whether a line may be trained right now, consuming a
+// token if so. It also refills the bucket and rolls the EWMA rate window
+// as a side effect, so every call - allowed or not - keeps Stats current.
+func (l *trainLimiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.refillLocked(now)
+	l.windowCount++
+	l.rollWindowLocked(now)
+
+	if l.tokens < 1 {
+		l.dropped++
+		return false
+	}
+	l.tokens--
+	l.trained++
+	return true
+}
+
+func (l *trainLimiter) refillLocked(now time.Time) {
+	elapsed := now.Sub(l.lastRefill).Seconds()
+	l.lastRefill = now
+	l.tokens += elapsed * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// rollWindowLocked folds the number of calls observed over the last
+// second into the EWMA rate once a full second has elapsed, then starts a
+// fresh window.
+func (l *trainLimiter) rollWindowLocked(now time.Time) {
+	elapsed := now.Sub(l.windowStart)
+	if elapsed < time.Second {
+		return
+	}
+	observedRate := float64(l.windowCount) / elapsed.Seconds()
+	l.ewmaRate += ewmaDecay * (observedRate - l.ewmaRate)
+	l.windowStart = now
+	l.windowCount = 0
+}
+
+func (l *trainLimiter) stats() (trained, dropped uint64, ewmaRate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.trained, l.dropped, l.ewmaRate
+}
+
+// TrainStats reports the Trained/Dropped counters and observed EWMA
+// ingestion rate of the optional rate limiter configured via
+// Config.MaxTrainRatePerSecond.
+type TrainStats struct {
+	Trained  uint64
+	Dropped  uint64
+	EWMARate float64
+}
+
+// Stats returns the current TrainStats. It's the zero value if no rate
+// limiter is configured.
+func (d *Drain) Stats() TrainStats {
+	if d.limiter == nil {
+		return TrainStats{}
+	}
+	trained, dropped, ewmaRate := d.limiter.stats()
+	return TrainStats{Trained: trained, Dropped: dropped, EWMARate: ewmaRate}
+}
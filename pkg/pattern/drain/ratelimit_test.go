@@ -0,0 +1,35 @@
+package drain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrainRateLimiterShedsExcessLines(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxTrainRatePerSecond = 1
+	cfg.BurstSize = 2
+	d := New(cfg, "")
+
+	// First line establishes a cluster so dropped lines have something to
+	// match against.
+	d.Train("caller=foo.go msg=hello", 0)
+	d.Train("caller=foo.go msg=hello", 1)
+
+	for i := 0; i < 10; i++ {
+		d.Train("caller=foo.go msg=hello", int64(i+2))
+	}
+
+	stats := d.Stats()
+	require.Greater(t, stats.Dropped, uint64(0))
+	require.Greater(t, stats.Trained, uint64(0))
+}
+
+func TestNoRateLimiterByDefault(t *testing.T) {
+	d := New(DefaultConfig(), "")
+	for i := 0; i < 100; i++ {
+		d.Train("caller=foo.go msg=hello", int64(i))
+	}
+	require.Equal(t, TrainStats{}, d.Stats())
+}
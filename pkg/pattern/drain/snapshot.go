@@ -0,0 +1,139 @@
+package drain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+)
+
+// snapshotFormatVersion is bumped whenever the on-disk encoding of a Drain
+// snapshot changes in a way that isn't backwards compatible, so LoadDrain
+// can reject blobs it no longer knows how to read.
+const snapshotFormatVersion byte = 1
+
+// snapshot is the gob-serializable representation of a Drain instance. It
+// captures everything Train/Match rely on to reproduce identical results
+// after a restore: the prefix tree, the cluster cache and the cluster ID
+// counter used to mint new cluster IDs.
+type snapshot struct {
+	Version         byte
+	ClustersCounter int
+	Root            *snapshotNode
+	// JSONRoots mirrors Drain.jsonRoots: one prefix-tree root per unique
+	// structured field-set signature, for Drain instances built with the
+	// "json" tokenizer. It's empty for every other tokenizer. gob decodes
+	// missing map fields as nil without error, so older snapshots taken
+	// before this field existed still restore cleanly - just with no
+	// JSON subtrees, which matches the fact they couldn't have had any.
+	JSONRoots map[string]*snapshotNode
+	Clusters  []snapshotCluster
+}
+
+// snapshotNode mirrors Node with exported fields so gob can encode it;
+// Node itself is kept unexported since it's an implementation detail of
+// the tree walk.
+type snapshotNode struct {
+	Children   map[string]*snapshotNode
+	ClusterIDs []int
+}
+
+// snapshotCluster mirrors the subset of LogCluster that defines a
+// cluster's identity and learned template; Stringer is a function value
+// and can't be serialized, so LoadDrain repopulates it from the
+// tokenizer passed in by the caller.
+type snapshotCluster struct {
+	ID     int
+	Tokens []string
+	Size   int
+	Chunks Chunks
+}
+
+// Snapshot serializes the full state of d - the prefix tree, the cluster
+// cache contents and the cluster ID counter - into a versioned binary
+// blob. The result can be handed to LoadDrain to restore an equivalent
+// Drain, so an ingester can warm up after a restart without losing
+// previously learned templates.
+//
+// Snapshot does not persist d's Config or tokenizer selection; callers
+// must supply the same ones to LoadDrain that were used to build d.
+func (d *Drain) Snapshot() ([]byte, error) {
+	s := snapshot{
+		Version:         snapshotFormatVersion,
+		ClustersCounter: d.clustersCounter,
+		Root:            snapshotNodeFrom(d.rootNode),
+		JSONRoots:       make(map[string]*snapshotNode, len(d.jsonRoots)),
+	}
+	for sig, root := range d.jsonRoots {
+		s.JSONRoots[sig] = snapshotNodeFrom(root)
+	}
+	for _, cluster := range d.idToCluster.Values() {
+		s.Clusters = append(s.Clusters, snapshotCluster{
+			ID:     cluster.id,
+			Tokens: cluster.Tokens,
+			Size:   cluster.Size,
+			Chunks: cluster.Chunks,
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&s); err != nil {
+		return nil, fmt.Errorf("failed to encode drain snapshot: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func snapshotNodeFrom(n *Node) *snapshotNode {
+	sn := &snapshotNode{
+		Children:   make(map[string]*snapshotNode, len(n.keyToChildNode)),
+		ClusterIDs: n.clusterIDs,
+	}
+	for key, child := range n.keyToChildNode {
+		sn.Children[key] = snapshotNodeFrom(child)
+	}
+	return sn
+}
+
+// LoadDrain restores a Drain previously serialized with Snapshot. cfg and
+// tokenizer must match the ones the snapshot was taken with - LoadDrain
+// does not store or validate them itself, it simply builds a fresh Drain
+// via New and repopulates it from data.
+func LoadDrain(cfg *Config, tokenizer string, data []byte) (*Drain, error) {
+	var s snapshot
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&s); err != nil {
+		return nil, fmt.Errorf("failed to decode drain snapshot: %w", err)
+	}
+	if s.Version != snapshotFormatVersion {
+		return nil, fmt.Errorf("unsupported drain snapshot version %d", s.Version)
+	}
+
+	d := New(cfg, tokenizer)
+	d.clustersCounter = s.ClustersCounter
+	if s.Root != nil {
+		d.rootNode = nodeFromSnapshot(s.Root)
+	}
+	for sig, sn := range s.JSONRoots {
+		d.jsonRoots[sig] = nodeFromSnapshot(sn)
+	}
+
+	for _, sc := range s.Clusters {
+		d.idToCluster.Set(sc.ID, &LogCluster{
+			id:       sc.ID,
+			Tokens:   sc.Tokens,
+			Size:     sc.Size,
+			Chunks:   sc.Chunks,
+			Stringer: d.tokenizer.Unmarshal,
+		})
+	}
+	return d, nil
+}
+
+func nodeFromSnapshot(sn *snapshotNode) *Node {
+	n := &Node{
+		keyToChildNode: make(map[string]*Node, len(sn.Children)),
+		clusterIDs:     sn.ClusterIDs,
+	}
+	for key, child := range sn.Children {
+		n.keyToChildNode[key] = nodeFromSnapshot(child)
+	}
+	return n
+}
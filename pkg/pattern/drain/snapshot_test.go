@@ -0,0 +1,77 @@
+package drain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	d := New(DefaultConfig(), "")
+
+	lines := []string{
+		"caller=foo.go user=bar msg=\"hello world\"",
+		"caller=foo.go user=baz msg=\"hello world\"",
+		"level=error err=\"connection refused\" addr=10.0.0.1:443",
+		"level=error err=\"connection refused\" addr=10.0.0.2:443",
+	}
+	for i, line := range lines {
+		d.Train(line, int64(i))
+	}
+
+	data, err := d.Snapshot()
+	require.NoError(t, err)
+	require.NotEmpty(t, data)
+
+	restored, err := LoadDrain(DefaultConfig(), "", data)
+	require.NoError(t, err)
+
+	for _, line := range lines {
+		want := d.Match(line)
+		got := restored.Match(line)
+		require.NotNil(t, want)
+		require.NotNil(t, got)
+		require.Equal(t, want.Tokens, got.Tokens)
+		require.Equal(t, want.Size, got.Size)
+	}
+
+	require.Nil(t, restored.Match("this line was never trained on"))
+}
+
+func TestSnapshotRoundTripJSONTokenizer(t *testing.T) {
+	d := New(DefaultConfig(), "json")
+
+	lines := []string{
+		`{"level":"info","msg":"started"}`,
+		`{"region":"us","code":200}`,
+	}
+	for i, line := range lines {
+		d.Train(line, int64(i))
+	}
+
+	data, err := d.Snapshot()
+	require.NoError(t, err)
+
+	restored, err := LoadDrain(DefaultConfig(), "json", data)
+	require.NoError(t, err)
+
+	require.Len(t, restored.jsonRoots, len(d.jsonRoots))
+	for _, line := range lines {
+		want := d.Match(line)
+		got := restored.Match(line)
+		require.NotNil(t, want)
+		require.NotNil(t, got, "line %s should still match after restore", line)
+		require.Equal(t, want.id, got.id)
+	}
+}
+
+func TestLoadDrainRejectsUnknownVersion(t *testing.T) {
+	var buf bytes.Buffer
+	s := snapshot{Version: snapshotFormatVersion + 1}
+	require.NoError(t, gob.NewEncoder(&buf).Encode(&s))
+
+	_, err := LoadDrain(DefaultConfig(), "", buf.Bytes())
+	require.Error(t, err)
+}